@@ -0,0 +1,204 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/danmane/abalone/go/progress"
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// githubBuildRequest is the shape of a github-sourced /images upload.
+type githubBuildRequest struct {
+	Owner      string
+	Repo       string
+	Ref        string
+	Dockerfile string // path within the repo, defaults to "Dockerfile"
+	Token      string // optional OAuth token for private repos
+}
+
+// GithubAgent records metadata about an agent image that was built from a
+// GitHub ref, so ListAgentsHandler can surface it distinctly from images
+// pulled directly from DockerHub.
+type GithubAgent struct {
+	Tag   string
+	Owner string
+	Repo  string
+	Ref   string
+	SHA   string
+}
+
+// githubAgents tracks GitHub-built agents in memory, keyed by tag.
+var githubAgents = struct {
+	sync.Mutex
+	byTag map[string]GithubAgent
+}{byTag: map[string]GithubAgent{}}
+
+// codeloadURL returns the tarball download URL for a given owner/repo/ref,
+// mirroring the scheme GitHub uses to serve archives without going through
+// the git protocol.
+func codeloadURL(owner, repo, ref string) string {
+	return fmt.Sprintf("https://codeload.github.com/%s/%s/tar.gz/%s", owner, repo, ref)
+}
+
+// buildGithubImage fetches the tarball for {owner, repo, ref}, streams it as
+// the Docker build context, and tags the resulting image. Docker's
+// line-delimited JSON build output is piped to |w| as it is produced.
+func (s *AgentSupervisor) buildGithubImage(req githubBuildRequest, w http.ResponseWriter) (GithubAgent, error) {
+	if req.Dockerfile == "" {
+		req.Dockerfile = "Dockerfile"
+	}
+
+	sha, err := resolveCommitSHA(req)
+	if err != nil {
+		return GithubAgent{}, fmt.Errorf("error resolving %s/%s@%s to a commit: %s", req.Owner, req.Repo, req.Ref, err)
+	}
+
+	httpReq, err := http.NewRequest("GET", codeloadURL(req.Owner, req.Repo, req.Ref), nil)
+	if err != nil {
+		return GithubAgent{}, fmt.Errorf("error building codeload request: %s", err)
+	}
+	if req.Token != "" {
+		httpReq.Header.Set("Authorization", "token "+req.Token)
+	}
+
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return GithubAgent{}, fmt.Errorf("error fetching %s/%s@%s: %s", req.Owner, req.Repo, req.Ref, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return GithubAgent{}, fmt.Errorf("error fetching %s/%s@%s: codeload returned %s", req.Owner, req.Repo, req.Ref, resp.Status)
+	}
+
+	tag := fmt.Sprintf("abalone/gh-%s-%s:%s", req.Owner, req.Repo, sha[:12])
+
+	// codeload always nests the archive's contents under a single
+	// <repo>-<sanitized-ref>/ directory, like GitHub's "Download ZIP".
+	// Strip it so Dockerfile paths are relative to the repo root rather
+	// than to a prefix whose exact sanitization we'd otherwise have to
+	// reproduce ourselves.
+	buildContext, err := stripTopLevelDir(resp.Body)
+	if err != nil {
+		return GithubAgent{}, fmt.Errorf("error unpacking %s/%s@%s tarball: %s", req.Owner, req.Repo, req.Ref, err)
+	}
+
+	if err := s.Client.BuildImage(docker.BuildImageOptions{
+		Name:          tag,
+		InputStream:   buildContext,
+		OutputStream:  w,
+		Dockerfile:    req.Dockerfile,
+		RawJSONStream: true,
+	}); err != nil {
+		return GithubAgent{}, fmt.Errorf("error building image: %s", err)
+	}
+
+	agent := GithubAgent{
+		Tag:   tag,
+		Owner: req.Owner,
+		Repo:  req.Repo,
+		Ref:   req.Ref,
+		SHA:   sha,
+	}
+
+	if err := s.ValidateImage(tag, progress.NewEmitter(w)); err != nil {
+		return GithubAgent{}, fmt.Errorf("built image %s failed validation: %s", tag, err)
+	}
+
+	githubAgents.Lock()
+	githubAgents.byTag[tag] = agent
+	githubAgents.Unlock()
+
+	return agent, nil
+}
+
+// stripTopLevelDir re-packs the gzipped tarball read from |gz| as a plain
+// tar with each entry's leading path component (the <repo>-<ref> directory
+// codeload wraps everything in) removed, so the result can be used as a
+// Docker build context whose root is the repo root.
+func stripTopLevelDir(gz io.Reader) (io.Reader, error) {
+	gzr, err := gzip.NewReader(gz)
+	if err != nil {
+		return nil, err
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		defer gzr.Close()
+		tr := tar.NewReader(gzr)
+		tw := tar.NewWriter(pw)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				pw.CloseWithError(tw.Close())
+				return
+			}
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+
+			name := hdr.Name
+			if idx := strings.Index(name, "/"); idx >= 0 {
+				name = name[idx+1:]
+			} else {
+				name = ""
+			}
+			if name == "" {
+				continue // the top-level directory entry itself
+			}
+			hdr.Name = name
+
+			if err := tw.WriteHeader(hdr); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+			if _, err := io.Copy(tw, tr); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+	}()
+	return pr, nil
+}
+
+// resolveCommitSHA asks the GitHub API what commit {owner, repo, ref}
+// currently points at, so callers can tag and record the actual commit a
+// build came from rather than the (possibly moving) ref name.
+func resolveCommitSHA(req githubBuildRequest) (string, error) {
+	url := fmt.Sprintf("https://api.github.com/repos/%s/%s/commits/%s", req.Owner, req.Repo, req.Ref)
+	httpReq, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return "", err
+	}
+	httpReq.Header.Set("Accept", "application/vnd.github.v3+json")
+	if req.Token != "" {
+		httpReq.Header.Set("Authorization", "token "+req.Token)
+	}
+
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("github API returned %s", resp.Status)
+	}
+
+	var body struct {
+		SHA string `json:"sha"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("error decoding github API response: %s", err)
+	}
+	if body.SHA == "" {
+		return "", fmt.Errorf("github API response had no sha field")
+	}
+	return body.SHA, nil
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	docker "github.com/fsouza/go-dockerclient"
+)
+
+// defaultIdleTimeout is how long a tracked container may sit with no
+// active requests before IdleTracker stops it, unless the image overrides
+// it via the abalone.idle_timeout label.
+const defaultIdleTimeout = 30 * time.Minute
+
+// defaultIdleCheckInterval is how often the background sweep looks for
+// containers to stop.
+const defaultIdleCheckInterval = 5 * time.Minute
+
+// idleTimeoutLabel is an image label that lets an agent author override
+// how long their container may idle before being stopped, e.g.
+// "abalone.idle_timeout=45m".
+const idleTimeoutLabel = "abalone.idle_timeout"
+
+// ContainerActivity reports how long a tracked container has been idle and
+// how many requests are in flight against it, for display via /running.
+type ContainerActivity struct {
+	IdleSince      time.Time
+	ActiveRequests int
+}
+
+type idleEntry struct {
+	lastActivity   time.Time
+	activeRequests int
+	timeout        time.Duration
+}
+
+// IdleTracker watches containers started for long-lived use (matches,
+// /running) and stops any that have had no active requests for longer
+// than their idle timeout.
+type IdleTracker struct {
+	client *docker.Client
+
+	mu      sync.Mutex
+	entries map[string]*idleEntry
+}
+
+// NewIdleTracker creates an IdleTracker and starts its background sweep,
+// which wakes every |interval| (defaultIdleCheckInterval if zero).
+func NewIdleTracker(client *docker.Client, interval time.Duration) *IdleTracker {
+	if interval == 0 {
+		interval = defaultIdleCheckInterval
+	}
+	t := &IdleTracker{
+		client:  client,
+		entries: map[string]*idleEntry{},
+	}
+	go t.sweepLoop(interval)
+	return t
+}
+
+// Track begins watching |containerID| for idleness. |timeout| overrides
+// defaultIdleTimeout; pass 0 to use the default. Track is a no-op on a nil
+// *IdleTracker, so callers that don't want idle tracking can simply leave
+// AgentSupervisor.IdleTracker unset.
+func (t *IdleTracker) Track(containerID string, timeout time.Duration) {
+	if t == nil {
+		return
+	}
+	if timeout == 0 {
+		timeout = defaultIdleTimeout
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.entries[containerID] = &idleEntry{lastActivity: time.Now(), timeout: timeout}
+}
+
+// Untrack stops watching |containerID|, e.g. because the caller already
+// stopped it.
+func (t *IdleTracker) Untrack(containerID string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.entries, containerID)
+}
+
+// BeginRequest marks |containerID| as having an in-flight request, which
+// exempts it from the idle sweep until a matching EndRequest is called.
+func (t *IdleTracker) BeginRequest(containerID string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	e, ok := t.entries[containerID]
+	if !ok {
+		return
+	}
+	e.activeRequests++
+	e.lastActivity = time.Now()
+}
+
+// EndRequest records that a request against |containerID| finished.
+func (t *IdleTracker) EndRequest(containerID string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	e, ok := t.entries[containerID]
+	if !ok {
+		return
+	}
+	e.activeRequests--
+	e.lastActivity = time.Now()
+}
+
+// Snapshot returns the current activity of every tracked container, keyed
+// by container ID.
+func (t *IdleTracker) Snapshot() map[string]ContainerActivity {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make(map[string]ContainerActivity, len(t.entries))
+	for id, e := range t.entries {
+		out[id] = ContainerActivity{IdleSince: e.lastActivity, ActiveRequests: e.activeRequests}
+	}
+	return out
+}
+
+func (t *IdleTracker) sweepLoop(interval time.Duration) {
+	for range time.Tick(interval) {
+		t.sweep()
+	}
+}
+
+func (t *IdleTracker) sweep() {
+	for _, id := range t.dueForStop(time.Now()) {
+		const kStopContainerTimeout = 5 // seconds
+		if err := t.client.StopContainer(id, kStopContainerTimeout); err != nil {
+			log.Printf("idle tracker: error stopping container %s: %s", id, err)
+			continue
+		}
+		t.Untrack(id)
+	}
+}
+
+// dueForStop returns the IDs of tracked containers that have no active
+// requests and have been idle past their timeout as of |now|. Split out
+// from sweep so the threshold logic can be tested without a Docker client.
+func (t *IdleTracker) dueForStop(now time.Time) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var due []string
+	for id, e := range t.entries {
+		if e.activeRequests == 0 && now.Sub(e.lastActivity) > e.timeout {
+			due = append(due, id)
+		}
+	}
+	return due
+}
+
+// idleTimeoutForImage reads the abalone.idle_timeout label off |image|, if
+// present, falling back to defaultIdleTimeout when the label is absent or
+// unparseable.
+func idleTimeoutForImage(client *docker.Client, image string) time.Duration {
+	info, err := client.InspectImage(image)
+	if err != nil || info.Config == nil {
+		return defaultIdleTimeout
+	}
+	raw, ok := info.Config.Labels[idleTimeoutLabel]
+	if !ok || strings.TrimSpace(raw) == "" {
+		return defaultIdleTimeout
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		log.Printf("idle tracker: invalid %s label %q on %s: %s", idleTimeoutLabel, raw, image, err)
+		return defaultIdleTimeout
+	}
+	return d
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIdleTrackerBeginEndRequestTracksActivity(t *testing.T) {
+	tr := NewIdleTracker(nil, time.Hour)
+	tr.Track("c1", time.Minute)
+
+	tr.BeginRequest("c1")
+	if a := tr.Snapshot()["c1"]; a.ActiveRequests != 1 {
+		t.Fatalf("ActiveRequests = %d, want 1", a.ActiveRequests)
+	}
+
+	tr.EndRequest("c1")
+	if a := tr.Snapshot()["c1"]; a.ActiveRequests != 0 {
+		t.Fatalf("ActiveRequests = %d, want 0", a.ActiveRequests)
+	}
+}
+
+func TestIdleTrackerBeginEndRequestIgnoresUntrackedContainer(t *testing.T) {
+	tr := NewIdleTracker(nil, time.Hour)
+	// c1 was never Track()ed; these must not panic or create an entry.
+	tr.BeginRequest("c1")
+	tr.EndRequest("c1")
+	if _, ok := tr.Snapshot()["c1"]; ok {
+		t.Fatalf("expected no entry for untracked container")
+	}
+}
+
+func TestIdleTrackerDueForStop(t *testing.T) {
+	tr := NewIdleTracker(nil, time.Hour)
+	now := time.Now()
+
+	tr.Track("idle", time.Minute)
+	tr.entries["idle"].lastActivity = now.Add(-2 * time.Minute)
+
+	tr.Track("active", time.Minute)
+	tr.entries["active"].lastActivity = now.Add(-2 * time.Minute)
+	tr.entries["active"].activeRequests = 1
+
+	tr.Track("fresh", time.Minute)
+	tr.entries["fresh"].lastActivity = now.Add(-10 * time.Second)
+
+	due := tr.dueForStop(now)
+	if len(due) != 1 || due[0] != "idle" {
+		t.Fatalf("dueForStop = %v, want [idle]", due)
+	}
+}
+
+func TestIdleTrackerUntrackRemovesEntry(t *testing.T) {
+	tr := NewIdleTracker(nil, time.Hour)
+	tr.Track("c1", time.Minute)
+	tr.Untrack("c1")
+	if _, ok := tr.Snapshot()["c1"]; ok {
+		t.Fatalf("expected entry to be removed after Untrack")
+	}
+}
+
+func TestIdleTrackerNilReceiverIsNoOp(t *testing.T) {
+	var tr *IdleTracker
+	tr.Track("c1", time.Minute)
+	tr.BeginRequest("c1")
+	tr.EndRequest("c1")
+	tr.Untrack("c1")
+	if tr.Snapshot() != nil {
+		t.Fatalf("expected nil snapshot from nil *IdleTracker")
+	}
+}
@@ -13,11 +13,34 @@ import (
 
 	"github.com/cenkalti/backoff"
 	"github.com/codegangsta/negroni"
+	"github.com/danmane/abalone/go/errdefs"
+	"github.com/danmane/abalone/go/httputils"
+	"github.com/danmane/abalone/go/progress"
 	"github.com/facebookgo/stackerr"
 	docker "github.com/fsouza/go-dockerclient"
 	"github.com/gorilla/mux"
 )
 
+// wrapDockerErr tags a raw go-dockerclient error with the errdefs kind a
+// caller would reasonably want to branch on, so it can be reported to an
+// HTTP client via httputils.WriteError.
+func wrapDockerErr(err error) error {
+	if err == nil {
+		return nil
+	}
+	switch err.(type) {
+	case *docker.NoSuchContainer:
+		return errdefs.NotFound(err)
+	}
+	switch err {
+	case docker.ErrNoSuchImage:
+		return errdefs.NotFound(err)
+	case docker.ErrConnectionRefused:
+		return errdefs.Unavailable(err)
+	}
+	return errdefs.System(err)
+}
+
 // If |useTLS| is enabled, look for the cert files here.
 var defaultCertPath = os.Getenv("DOCKER_CERT_PATH")
 
@@ -55,7 +78,7 @@ func run() error {
 			return err
 		}
 	}
-	s := &AgentSupervisor{Client: client}
+	s := &AgentSupervisor{Client: client, IdleTracker: NewIdleTracker(client, defaultIdleCheckInterval)}
 	log.Printf("listening at %s", *host)
 	log.Fatal(http.ListenAndServe(*host, Router(s, *staticPath)))
 	return nil
@@ -87,7 +110,9 @@ func WireAPIRoutes(r *mux.Router, s *AgentSupervisor) {
 	apiV0 := r.PathPrefix("/api/v0").Subrouter()
 
 	// TODO Build an agent from a GitHub repo
-	// TODO Run Game between two running agents
+
+	// run a match between two agent images, streaming NDJSON move events
+	apiV0.Path("/matches").Methods("POST").HandlerFunc(RunMatchHandler(s))
 
 	agents := apiV0.Path("/agents").Subrouter()
 	agents.Methods("GET").HandlerFunc(ListAgentsHandler(s)) // list all available agents
@@ -110,25 +135,73 @@ func WireAPIRoutes(r *mux.Router, s *AgentSupervisor) {
 }
 
 // PullDockerHubAgentHandler pulls the Docker image named |image| from
-// DockerHub.
+// DockerHub, streaming progress to the client as our NDJSON protocol
+// rather than the Docker daemon's raw stream.
 func PullDockerHubAgentHandler(s *AgentSupervisor) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.FormValue("image") == "" {
-			w.WriteHeader(http.StatusBadRequest)
+			httputils.WriteError(w, errdefs.InvalidParameter(fmt.Errorf("`image` parameter is required")))
 			return
 		}
-		if err := s.Client.PullImage(docker.PullImageOptions{
-			OutputStream: w,
-			Registry:     "https://index.docker.io",
-			Repository:   r.FormValue("image"),
-			Tag:          "latest",
-		}, docker.AuthConfiguration{}); err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			fmt.Fprintln(w, err)
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		emit := progress.NewEmitter(w)
+
+		pr, pw := io.Pipe()
+		done := make(chan error, 1)
+		go func() {
+			done <- relayPullProgress(pr, emit)
+		}()
+
+		pullErr := s.Client.PullImage(docker.PullImageOptions{
+			OutputStream:  pw,
+			RawJSONStream: true,
+			Registry:      "https://index.docker.io",
+			Repository:    r.FormValue("image"),
+			Tag:           "latest",
+		}, docker.AuthConfiguration{})
+		pw.Close()
+		relayErr := <-done
+
+		if pullErr != nil {
+			emit.Phase("pull", fmt.Sprintf("error: %s", wrapDockerErr(pullErr)))
+		} else if relayErr != nil {
+			log.Printf("error relaying pull progress for %s: %s", r.FormValue("image"), relayErr)
+			emit.Phase("pull", fmt.Sprintf("error reading pull progress: %s", relayErr))
 		}
 	}
 }
 
+// dockerStreamMessage mirrors the subset of fields the Docker daemon emits
+// on its raw pull/build progress stream.
+type dockerStreamMessage struct {
+	Status         string `json:"status"`
+	ID             string `json:"id"`
+	ProgressDetail struct {
+		Current int64 `json:"current"`
+		Total   int64 `json:"total"`
+	} `json:"progressDetail"`
+}
+
+// relayPullProgress reads the Docker daemon's raw JSON-lines pull stream
+// from |r| and re-emits each message as a "pull" phase event.
+func relayPullProgress(r io.Reader, emit *progress.Emitter) error {
+	dec := json.NewDecoder(r)
+	for {
+		var msg dockerStreamMessage
+		if err := dec.Decode(&msg); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		ev := progress.Event{Phase: "pull", Status: msg.Status, ID: msg.ID}
+		if msg.ProgressDetail.Total > 0 {
+			ev.Progress = &progress.Progress{Current: msg.ProgressDetail.Current, Total: msg.ProgressDetail.Total}
+		}
+		emit.Emit(ev)
+	}
+}
+
 // ListAgentsHandler lists AI agents.
 func ListAgentsHandler(s *AgentSupervisor) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -136,11 +209,7 @@ func ListAgentsHandler(s *AgentSupervisor) http.HandlerFunc {
 			All: false,
 		})
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			_, err := io.WriteString(w, err.Error())
-			if err != nil {
-				log.Println("error writing err: %s", err)
-			}
+			httputils.WriteError(w, wrapDockerErr(err))
 			return
 		}
 		for _, img := range images {
@@ -153,20 +222,44 @@ func ListAgentsHandler(s *AgentSupervisor) http.HandlerFunc {
 				}
 			}
 		}
+
+		githubAgents.Lock()
+		defer githubAgents.Unlock()
+		for tag, agent := range githubAgents.byTag {
+			fmt.Fprintf(w, "%s\t(built from %s/%s@%s, sha %s)\n", tag, agent.Owner, agent.Repo, agent.Ref, agent.SHA)
+		}
 	}
 }
 
-// ListActiveAgentsHandler lists agents that are currently running.
+// activeContainer is a running container annotated with the idle-tracking
+// state ListActiveAgentsHandler surfaces.
+type activeContainer struct {
+	docker.APIContainers
+	IdleSince      time.Time `json:"IdleSince,omitempty"`
+	ActiveRequests int       `json:"ActiveRequests"`
+}
+
+// ListActiveAgentsHandler lists agents that are currently running, along
+// with how long each has been idle and how many requests are in flight
+// against it.
 func ListActiveAgentsHandler(s *AgentSupervisor) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		containers, err := s.Client.ListContainers(docker.ListContainersOptions{})
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+			httputils.WriteError(w, wrapDockerErr(err))
 			return
 		}
+		activity := s.IdleTracker.Snapshot()
+
+		result := make([]activeContainer, 0, len(containers))
 		for _, ps := range containers {
-			fmt.Fprintln(w, fmt.Sprintf("%+v\n", ps))
+			ac := activeContainer{APIContainers: ps}
+			if a, ok := activity[ps.ID]; ok {
+				ac.IdleSince, ac.ActiveRequests = a.IdleSince, a.ActiveRequests
+			}
+			result = append(result, ac)
 		}
+		json.NewEncoder(w).Encode(result)
 	}
 }
 
@@ -184,11 +277,13 @@ func ValidateAgentHandler(s *AgentSupervisor) http.HandlerFunc {
 		}
 		image := r.FormValue("image")
 
-		if err := s.ValidateImage(image); err != nil {
-			fmt.Fprintf(w, "image %s is not valid. error: %s", image, err)
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		emit := progress.NewEmitter(w)
+		if err := s.ValidateImage(image, emit); err != nil {
+			emit.Phase("validate", fmt.Sprintf("image %s is not valid. error: %s", image, err))
 			return
 		}
-		fmt.Fprintf(w, "image %s is valid", image)
+		emit.Phase("validate", fmt.Sprintf("image %s is valid", image))
 	}
 }
 
@@ -216,25 +311,55 @@ func UploadImageHandler(s *AgentSupervisor) http.HandlerFunc {
 		rs := struct {
 			Image  string
 			Source string
+
+			// Fields used when Source == "github".
+			Owner      string
+			Repo       string
+			Ref        string
+			Dockerfile string
 		}{}
 		if err := json.NewDecoder(r.Body).Decode(&rs); err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprintf(w, "error decoding request: %s", err)
+			httputils.WriteError(w, errdefs.InvalidParameter(fmt.Errorf("error decoding request: %s", err)))
 			return
 		}
 		switch rs.Source {
 		case "dockerhub":
-			if err := s.ValidateImage(rs.Image); err != nil {
-				w.WriteHeader(http.StatusBadRequest)
-				fmt.Fprintf(w, "image %s is not valid. error: %s", rs.Image, err)
+			// ValidateImage has already been streaming progress events
+			// into w by the time it can fail, so a failure has to be
+			// reported as another event in that same NDJSON stream
+			// rather than via httputils.WriteError, which would try
+			// (too late) to set a response header and then splice a
+			// foreign JSON shape into the middle of the stream.
+			emit := progress.NewEmitter(w)
+			if err := s.ValidateImage(rs.Image, emit); err != nil {
+				emit.Phase("validate", fmt.Sprintf("image %s is not valid. error: %s", rs.Image, err))
 				return
 			}
 		case "github":
-			w.WriteHeader(http.StatusNotImplemented)
-			fmt.Fprintln(w, "Sorry. GitHub repo support has not been implemented yet.")
+			if rs.Owner == "" || rs.Repo == "" || rs.Ref == "" {
+				httputils.WriteError(w, errdefs.InvalidParameter(fmt.Errorf("`Owner`, `Repo`, and `Ref` are required for github source")))
+				return
+			}
+			// Same reasoning as the dockerhub case: buildGithubImage may
+			// already have written Docker's build output or validation
+			// events to w by the time it fails, so its failures are
+			// always reported in-stream.
+			if _, err := s.buildGithubImage(githubBuildRequest{
+				Owner:      rs.Owner,
+				Repo:       rs.Repo,
+				Ref:        rs.Ref,
+				Dockerfile: rs.Dockerfile,
+				// Private repos pass their GitHub token via the
+				// X-Github-Token header rather than the JSON body, so
+				// it doesn't end up logged alongside the rest of the
+				// request.
+				Token: r.Header.Get("X-Github-Token"),
+			}, w); err != nil {
+				progress.NewEmitter(w).Phase("build", fmt.Sprintf("error building %s/%s@%s: %s", rs.Owner, rs.Repo, rs.Ref, err))
+				return
+			}
 		default:
-			w.WriteHeader(http.StatusBadRequest)
-			fmt.Fprintf(w, "Unrecognized image source: %s", rs.Source)
+			httputils.WriteError(w, errdefs.InvalidParameter(fmt.Errorf("unrecognized image source: %s", rs.Source)))
 		}
 	}
 }
@@ -242,64 +367,215 @@ func UploadImageHandler(s *AgentSupervisor) http.HandlerFunc {
 // AgentSupervisor manages AI agents running in Docker containers
 type AgentSupervisor struct {
 	Client *docker.Client
-}
 
-func (s *AgentSupervisor) ValidateImage(image string) error {
+	// IdleTracker stops long-lived agent containers (matches, /running)
+	// that have gone unused for too long. It is nil-safe: a nil
+	// *IdleTracker is simply a no-op, so code paths that don't need
+	// idle tracking (like ValidateImage's own ephemeral container) don't
+	// have to special-case it.
+	IdleTracker *IdleTracker
+}
 
-	// run the container in a two-phase process. First, create the
-	// container.
+// agentPort is the TCP port every agent image is expected to expose, unless
+// it overrides this via the agentPortLabel.
+const agentPort = "3423/tcp"
+
+// agentPortLabel lets an image declare a non-default agent port, e.g.
+// "abalone.port=4000".
+const agentPortLabel = "abalone.port"
+
+// healthyTimeout bounds how long ValidateImage waits for a container that
+// declares a HEALTHCHECK to report health_status: healthy.
+const healthyTimeout = 2 * time.Minute
+
+// startAgentContainer creates and starts a container from |image|,
+// publishing all of its ports, and returns the container ID together with
+// the host address it can be reached at. Callers are responsible for
+// stopping the container once they are done with it. |emit| is an optional
+// progress emitter; pass nil when there is no HTTP client to stream phases
+// to.
+func (s *AgentSupervisor) startAgentContainer(image string, emit *progress.Emitter) (containerID, ip, port string, err error) {
+	if emit != nil {
+		emit.Phase("create", fmt.Sprintf("creating container from %s", image))
+	}
 	container, err := s.Client.CreateContainer(docker.CreateContainerOptions{
 		Config: &docker.Config{
 			Image: image, // the only required argument
 		},
 	})
 	if err != nil {
-		return fmt.Errorf("error creating container:", err.Error())
+		return "", "", "", wrapDockerErr(err)
 	}
 
 	hc := &docker.HostConfig{
 		PublishAllPorts: true,
 	}
 
+	if emit != nil {
+		emit.Phase("start", fmt.Sprintf("starting container %s", container.ID))
+	}
 	// run the created container
 	if err := s.Client.StartContainer(container.ID, hc); err != nil {
-		return fmt.Errorf("error starting container: %s", err.Error())
+		return "", "", "", wrapDockerErr(err)
+	}
+
+	targetPort := agentPortForImage(s.Client, image)
+	if emit != nil {
+		emit.Phase("port-discover", fmt.Sprintf("discovering port %s", targetPort))
+	}
+	ip, port, err = s.discoverAgentPort(container.ID, targetPort)
+	if err != nil {
+		// The container is already running but the caller won't get its
+		// ID, so stop it here rather than leak it.
+		const kStopContainerTimeout = 5 // seconds
+		if stopErr := s.Client.StopContainer(container.ID, kStopContainerTimeout); stopErr != nil {
+			log.Printf("error stopping container %s after port discovery failed: %s", container.ID, stopErr)
+		}
+		return "", "", "", err
 	}
+	return container.ID, ip, port, nil
+}
 
-	// ensure the proper port is exposed
-	info, err := s.Client.InspectContainer(container.ID)
+// agentPortForImage returns the agentPortLabel override declared by |image|,
+// if any, or agentPort otherwise.
+func agentPortForImage(client *docker.Client, image string) docker.Port {
+	info, err := client.InspectImage(image)
+	if err != nil || info.Config == nil {
+		return docker.Port(agentPort)
+	}
+	if override, ok := info.Config.Labels[agentPortLabel]; ok && override != "" {
+		return docker.Port(override + "/tcp")
+	}
+	return docker.Port(agentPort)
+}
+
+// discoverAgentPort inspects the container identified by |containerID| and
+// returns the host address of its published |targetPort| mapping.
+func (s *AgentSupervisor) discoverAgentPort(containerID string, targetPort docker.Port) (ip, port string, err error) {
+	info, err := s.Client.InspectContainer(containerID)
 	if err != nil {
-		return fmt.Errorf("error inspecting container: %s", err.Error())
+		return "", "", wrapDockerErr(err)
 	}
 
-	mappings, ok := info.NetworkSettings.Ports[docker.Port("3423/tcp")]
+	mappings, ok := info.NetworkSettings.Ports[targetPort]
 	if !ok {
-		return fmt.Errorf(
-			"container must expose port 3423/tcp. Found: %+v",
-			info.NetworkSettings.Ports)
+		return "", "", errdefs.InvalidParameter(fmt.Errorf(
+			"container must expose port %s. Found: %+v",
+			targetPort, info.NetworkSettings.Ports))
 	}
 	if len(mappings) != 1 {
-		return fmt.Errorf(
+		return "", "", errdefs.InvalidParameter(fmt.Errorf(
 			"error. expected one port mapping. found: %+v",
-			info.NetworkSettings.Ports)
+			info.NetworkSettings.Ports))
+	}
+	return mappings[0].HostIP, mappings[0].HostPort, nil
+}
+
+// ValidateImage starts |image| as a container and confirms it is ready to
+// serve the agent protocol. If the image declares a Docker HEALTHCHECK,
+// readiness is determined by subscribing to the daemon's event stream and
+// waiting for a health_status: healthy event, which also surfaces die/oom
+// failures immediately instead of as an opaque timeout. Images without a
+// declared healthcheck fall back to the old /ping retry loop. If |emit| is
+// non-nil, phase transitions are streamed to it as they happen; pass nil
+// when called outside an HTTP context.
+func (s *AgentSupervisor) ValidateImage(image string, emit *progress.Emitter) error {
+
+	containerID, ip, port, err := s.startAgentContainer(image, emit)
+	if err != nil {
+		return err
+	}
+	// Stop the container on every exit path, not just the happy one —
+	// otherwise an image that fails readiness (unreachable, never
+	// healthy, died) leaks its container, since nothing else is tracking
+	// it for later cleanup.
+	defer func() {
+		if emit != nil {
+			emit.Phase("stop", fmt.Sprintf("stopping container %s", containerID))
+		}
+		const kStopContainerTimeout = 5 // seconds
+		if err := s.Client.StopContainer(containerID, kStopContainerTimeout); err != nil {
+			log.Printf("error stopping container %s after validation: %s", containerID, err)
+		}
+	}()
+
+	imageInfo, err := s.Client.InspectImage(image)
+	if err != nil {
+		return wrapDockerErr(err)
+	}
+
+	if imageInfo.Config != nil && imageInfo.Config.Healthcheck != nil {
+		if emit != nil {
+			emit.Phase("healthcheck", fmt.Sprintf("waiting for %s to report healthy", containerID))
+		}
+		if err := s.waitForHealthy(containerID, emit); err != nil {
+			return err
+		}
+	} else if err := s.pingUntilReady(ip, port, emit); err != nil {
+		return err
 	}
-	ip, port := mappings[0].HostIP, mappings[0].HostPort
 
+	return nil
+}
+
+// waitForHealthy subscribes to the Docker daemon's event stream and blocks
+// until |containerID| reports a health_status: healthy event, it dies or
+// OOMs, or healthyTimeout elapses.
+func (s *AgentSupervisor) waitForHealthy(containerID string, emit *progress.Emitter) error {
+	listener := make(chan *docker.APIEvents, 16)
+	if err := s.Client.AddEventListener(listener); err != nil {
+		return errdefs.Unavailable(fmt.Errorf("error subscribing to docker events: %s", err))
+	}
+	defer s.Client.RemoveEventListener(listener)
+
+	deadline := time.After(healthyTimeout)
+	for {
+		select {
+		case ev := <-listener:
+			if ev == nil || ev.ID != containerID {
+				continue
+			}
+			switch ev.Status {
+			case "health_status: healthy":
+				return nil
+			case "health_status: unhealthy":
+				if emit != nil {
+					emit.Phase("healthcheck", fmt.Sprintf("container %s reported unhealthy, still waiting", containerID))
+				}
+			case "die":
+				return errdefs.System(fmt.Errorf("container %s died before becoming healthy", containerID))
+			case "oom":
+				return errdefs.System(fmt.Errorf("container %s was OOM-killed before becoming healthy", containerID))
+			}
+		case <-deadline:
+			return errdefs.Unavailable(fmt.Errorf("container %s did not become healthy within %s", containerID, healthyTimeout))
+		}
+	}
+}
+
+// pingUntilReady is the fallback readiness check for images that don't
+// declare a HEALTHCHECK: it polls /ping with exponential backoff, same as
+// ValidateImage always did before waitForHealthy existed.
+func (s *AgentSupervisor) pingUntilReady(ip, port string, emit *progress.Emitter) error {
+	retry := 0
 	backoffConfig := backoff.NewExponentialBackOff()
 	backoffConfig.InitialInterval = time.Second
 	backoffConfig.MaxInterval = 10
 	backoffConfig.MaxElapsedTime = 10 * time.Second
-	err = backoff.Retry(func() error {
+	err := backoff.Retry(func() error {
+		retry++
+		if emit != nil {
+			emit.Phase(fmt.Sprintf("ping-retry %d", retry), fmt.Sprintf("pinging http://%s:%s/ping", ip, port))
+		}
 		resp, err := http.Get(fmt.Sprintf("http://%s:%s/ping", ip, port))
 		if err != nil {
 			log.Println("error pinging agent. found:", err)
-			// TODO handle err
 			return err
 		}
 		defer resp.Body.Close()
 		var agentInfo AgentInfo
 		if err := json.NewDecoder(resp.Body).Decode(&agentInfo); err != nil {
-			return err
+			return errdefs.InvalidParameter(fmt.Errorf("agent responded but did not speak the expected protocol: %s", err))
 		}
 		if agentInfo.Owner == "btc" {
 			log.Println("yay!")
@@ -307,13 +583,11 @@ func (s *AgentSupervisor) ValidateImage(image string) error {
 		return nil
 	}, backoffConfig)
 
-	// TODO check error in case ping didn't work
-
-	const kStopContainerTimeout = 5 // seconds
-	if err := s.Client.StopContainer(container.ID, kStopContainerTimeout); err != nil {
-		return err
+	if err != nil {
+		if errdefs.IsInvalidParameter(err) {
+			return err
+		}
+		return errdefs.Unavailable(fmt.Errorf("agent never became reachable: %s", err))
 	}
 	return nil
 }
-
-// TODO check error in case ping didn't work
\ No newline at end of file
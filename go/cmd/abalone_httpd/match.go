@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/danmane/abalone/go/api"
+	"github.com/danmane/abalone/go/game"
+)
+
+// MatchOptions configures a single RunMatch invocation.
+type MatchOptions struct {
+	// MoveDeadline bounds how long an agent has to respond to a /move
+	// request. An agent that misses the deadline forfeits the game.
+	MoveDeadline time.Duration
+}
+
+// defaultMoveDeadline is used when the caller doesn't specify one.
+const defaultMoveDeadline = 5 * time.Second
+
+// MatchEvent is streamed to the client as one NDJSON line per move while a
+// match is in progress.
+type MatchEvent struct {
+	Turn  int         `json:"turn"`
+	Move  interface{} `json:"move"`
+	State *game.State `json:"state"`
+}
+
+// moveResponse is the payload an agent returns from its /move endpoint.
+type moveResponse struct {
+	Move game.Move `json:"move"`
+}
+
+// RunMatch starts the |white| and |black| images as containers and drives a
+// full game between them, alternately POSTing the current game.State to
+// each agent's /move endpoint and applying the move it returns. If
+// |onEvent| is non-nil, it is invoked after every move so callers can
+// stream progress (e.g. to an HTTP client as NDJSON).
+func (s *AgentSupervisor) RunMatch(white, black string, opts MatchOptions, onEvent func(MatchEvent)) (api.GameResult, error) {
+	deadline := opts.MoveDeadline
+	if deadline == 0 {
+		deadline = defaultMoveDeadline
+	}
+
+	whiteID, whiteIP, whitePort, err := s.startAgentContainer(white, nil)
+	if err != nil {
+		return api.GameResult{}, fmt.Errorf("error starting white agent %s: %s", white, err)
+	}
+	s.IdleTracker.Track(whiteID, idleTimeoutForImage(s.Client, white))
+	defer s.stopAgentContainer(whiteID)
+
+	blackID, blackIP, blackPort, err := s.startAgentContainer(black, nil)
+	if err != nil {
+		return api.GameResult{}, fmt.Errorf("error starting black agent %s: %s", black, err)
+	}
+	s.IdleTracker.Track(blackID, idleTimeoutForImage(s.Client, black))
+	defer s.stopAgentContainer(blackID)
+
+	addrs := map[game.Player]string{
+		game.White: fmt.Sprintf("http://%s:%s/move", whiteIP, whitePort),
+		game.Black: fmt.Sprintf("http://%s:%s/move", blackIP, blackPort),
+	}
+	containerIDs := map[game.Player]string{game.White: whiteID, game.Black: blackID}
+
+	httpClient := &http.Client{Timeout: deadline}
+
+	state := game.NewState()
+	states := []game.State{*state}
+	result := api.GameResult{
+		White: api.Player{Name: white},
+		Black: api.Player{Name: black},
+	}
+
+	for turn := 1; ; turn++ {
+		outcome, finished := state.Outcome()
+		if finished {
+			result.Outcome = outcome
+			break
+		}
+
+		mover := state.ToMove()
+		body, err := json.Marshal(state)
+		if err != nil {
+			return api.GameResult{}, fmt.Errorf("error marshaling state: %s", err)
+		}
+
+		s.IdleTracker.BeginRequest(containerIDs[mover])
+		resp, err := httpClient.Post(addrs[mover], "application/json", bytes.NewReader(body))
+		s.IdleTracker.EndRequest(containerIDs[mover])
+		if err != nil {
+			result.Outcome, result.VictoryReason = forfeit(mover), "timeout"
+			break
+		}
+		var mv moveResponse
+		decodeErr := json.NewDecoder(resp.Body).Decode(&mv)
+		resp.Body.Close()
+		if decodeErr != nil {
+			result.Outcome, result.VictoryReason = forfeit(mover), "malformed-response"
+			break
+		}
+
+		next, err := state.Apply(mv.Move)
+		if err != nil {
+			result.Outcome, result.VictoryReason = forfeit(mover), "illegal-move"
+			break
+		}
+		state = next
+		states = append(states, *state)
+
+		if onEvent != nil {
+			onEvent(MatchEvent{Turn: turn, Move: mv.Move, State: state})
+		}
+	}
+
+	result.States = states
+	return result, nil
+}
+
+// forfeit returns the outcome in which |mover| loses by forfeit.
+func forfeit(mover game.Player) game.Outcome {
+	if mover == game.White {
+		return game.BlackWins
+	}
+	return game.WhiteWins
+}
+
+// stopAgentContainer stops a container started for a match, logging (rather
+// than propagating) any error since it runs from a defer during cleanup.
+func (s *AgentSupervisor) stopAgentContainer(containerID string) {
+	s.IdleTracker.Untrack(containerID)
+	const kStopContainerTimeout = 5 // seconds
+	if err := s.Client.StopContainer(containerID, kStopContainerTimeout); err != nil {
+		log.Printf("error stopping container %s: %s", containerID, err)
+	}
+}
+
+// RunMatchHandler runs a match between two agent images and streams one
+// NDJSON event per move to the client as the game progresses.
+func RunMatchHandler(s *AgentSupervisor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req := struct {
+			White        string
+			Black        string
+			MoveDeadline time.Duration
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "error decoding request: %s", err)
+			return
+		}
+		if req.White == "" || req.Black == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintln(w, "`White` and `Black` image names are required")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		flusher, _ := w.(http.Flusher)
+		enc := json.NewEncoder(w)
+
+		result, err := s.RunMatch(req.White, req.Black, MatchOptions{MoveDeadline: req.MoveDeadline}, func(ev MatchEvent) {
+			enc.Encode(ev)
+			if flusher != nil {
+				flusher.Flush()
+			}
+		})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, "error running match: %s", err)
+			return
+		}
+		enc.Encode(result)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,150 @@
+// Package errdefs defines a set of error interfaces that components
+// throughout abalone can use to tag errors with a semantic "kind" without
+// coupling to a concrete error type or a transport-specific status code.
+// Handlers can then ask "is this a not-found error?" and let
+// go/httputils map it to the right HTTP status, regardless of where the
+// error originated.
+package errdefs
+
+// ErrNotFound signals that the requested object does not exist.
+type ErrNotFound interface {
+	NotFound()
+}
+
+// ErrInvalidParameter signals that the user supplied a bad value.
+type ErrInvalidParameter interface {
+	InvalidParameter()
+}
+
+// ErrConflict signals that the request conflicts with the current state of
+// the target resource (e.g. a container that's already running).
+type ErrConflict interface {
+	Conflict()
+}
+
+// ErrUnavailable signals that a dependency (e.g. the Docker daemon) could
+// not be reached.
+type ErrUnavailable interface {
+	Unavailable()
+}
+
+// ErrSystem signals an unexpected internal failure that isn't the caller's
+// fault.
+type ErrSystem interface {
+	System()
+}
+
+type causer interface {
+	Cause() error
+}
+
+type unwrapper interface {
+	Unwrap() error
+}
+
+// walk calls match on err and each error it wraps, via either Cause()
+// (the convention used by github.com/facebookgo/stackerr and
+// github.com/pkg/errors) or the standard library's Unwrap(), stopping as
+// soon as match returns true.
+func walk(err error, match func(error) bool) bool {
+	for err != nil {
+		if match(err) {
+			return true
+		}
+		switch e := err.(type) {
+		case causer:
+			err = e.Cause()
+		case unwrapper:
+			err = e.Unwrap()
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// IsNotFound reports whether any error in err's cause chain is an
+// ErrNotFound.
+func IsNotFound(err error) bool {
+	return walk(err, func(e error) bool { _, ok := e.(ErrNotFound); return ok })
+}
+
+// IsInvalidParameter reports whether any error in err's cause chain is an
+// ErrInvalidParameter.
+func IsInvalidParameter(err error) bool {
+	return walk(err, func(e error) bool { _, ok := e.(ErrInvalidParameter); return ok })
+}
+
+// IsConflict reports whether any error in err's cause chain is an
+// ErrConflict.
+func IsConflict(err error) bool {
+	return walk(err, func(e error) bool { _, ok := e.(ErrConflict); return ok })
+}
+
+// IsUnavailable reports whether any error in err's cause chain is an
+// ErrUnavailable.
+func IsUnavailable(err error) bool {
+	return walk(err, func(e error) bool { _, ok := e.(ErrUnavailable); return ok })
+}
+
+// IsSystem reports whether any error in err's cause chain is an ErrSystem.
+func IsSystem(err error) bool {
+	return walk(err, func(e error) bool { _, ok := e.(ErrSystem); return ok })
+}
+
+// kindedError wraps an underlying error so it can be embedded by the
+// single-interface wrapper types below (notFoundError, conflictError,
+// ...). Callers should use the named constructors (NotFound, Conflict,
+// ...) rather than this directly.
+type kindedError struct {
+	error
+}
+
+func (e kindedError) Error() string { return e.error.Error() }
+func (e kindedError) Cause() error  { return e.error }
+
+type notFoundError struct{ kindedError }
+
+func (notFoundError) NotFound() {}
+
+// NotFound wraps err so that errdefs.IsNotFound(err) reports true.
+func NotFound(err error) error {
+	return notFoundError{kindedError{error: err}}
+}
+
+type invalidParameterError struct{ kindedError }
+
+func (invalidParameterError) InvalidParameter() {}
+
+// InvalidParameter wraps err so that errdefs.IsInvalidParameter(err)
+// reports true.
+func InvalidParameter(err error) error {
+	return invalidParameterError{kindedError{error: err}}
+}
+
+type conflictError struct{ kindedError }
+
+func (conflictError) Conflict() {}
+
+// Conflict wraps err so that errdefs.IsConflict(err) reports true.
+func Conflict(err error) error {
+	return conflictError{kindedError{error: err}}
+}
+
+type unavailableError struct{ kindedError }
+
+func (unavailableError) Unavailable() {}
+
+// Unavailable wraps err so that errdefs.IsUnavailable(err) reports true.
+func Unavailable(err error) error {
+	return unavailableError{kindedError{error: err}}
+}
+
+type systemError struct{ kindedError }
+
+func (systemError) System() {}
+
+// System wraps err so that errdefs.IsSystem(err) reports true.
+func System(err error) error {
+	return systemError{kindedError{error: err}}
+}
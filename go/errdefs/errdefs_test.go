@@ -0,0 +1,86 @@
+package errdefs
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// causeWrapper wraps an error using the Cause() convention (stackerr,
+// pkg/errors), rather than the standard library's Unwrap().
+type causeWrapper struct {
+	msg   string
+	cause error
+}
+
+func (e causeWrapper) Error() string { return e.msg }
+func (e causeWrapper) Cause() error  { return e.cause }
+
+func TestIsNotFoundMatchesTaggedError(t *testing.T) {
+	err := NotFound(errors.New("no such image"))
+	if !IsNotFound(err) {
+		t.Fatalf("expected IsNotFound to be true")
+	}
+	if IsConflict(err) || IsSystem(err) || IsUnavailable(err) || IsInvalidParameter(err) {
+		t.Fatalf("expected err to match only IsNotFound")
+	}
+}
+
+func TestIsNotFoundWalksCauseChain(t *testing.T) {
+	tagged := NotFound(errors.New("no such container"))
+	wrapped := causeWrapper{msg: "inspecting container", cause: tagged}
+	if !IsNotFound(wrapped) {
+		t.Fatalf("expected IsNotFound to walk the Cause() chain")
+	}
+}
+
+func TestIsNotFoundWalksStandardUnwrapChain(t *testing.T) {
+	tagged := NotFound(errors.New("no such container"))
+	wrapped := fmt.Errorf("inspecting container: %w", tagged)
+	if !IsNotFound(wrapped) {
+		t.Fatalf("expected IsNotFound to walk the standard library's Unwrap() chain")
+	}
+}
+
+func TestIsKindFalseForUntaggedError(t *testing.T) {
+	err := errors.New("plain error")
+	if IsNotFound(err) || IsInvalidParameter(err) || IsConflict(err) || IsUnavailable(err) || IsSystem(err) {
+		t.Fatalf("expected a plain error to match no kind")
+	}
+}
+
+func TestEachConstructorTagsExactlyItsOwnKind(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		is   func(error) bool
+	}{
+		{"NotFound", NotFound(errors.New("x")), IsNotFound},
+		{"InvalidParameter", InvalidParameter(errors.New("x")), IsInvalidParameter},
+		{"Conflict", Conflict(errors.New("x")), IsConflict},
+		{"Unavailable", Unavailable(errors.New("x")), IsUnavailable},
+		{"System", System(errors.New("x")), IsSystem},
+	}
+	all := []func(error) bool{IsNotFound, IsInvalidParameter, IsConflict, IsUnavailable, IsSystem}
+	for _, c := range cases {
+		if !c.is(c.err) {
+			t.Errorf("%s: expected matching Is* to be true", c.name)
+		}
+		matches := 0
+		for _, is := range all {
+			if is(c.err) {
+				matches++
+			}
+		}
+		if matches != 1 {
+			t.Errorf("%s: matched %d kinds, want exactly 1", c.name, matches)
+		}
+	}
+}
+
+func TestErrorMessageIsPreserved(t *testing.T) {
+	err := NotFound(errors.New("no such image"))
+	if err.Error() != "no such image" {
+		t.Fatalf("Error() = %q, want %q", err.Error(), "no such image")
+	}
+}
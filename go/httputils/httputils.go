@@ -0,0 +1,40 @@
+// Package httputils holds small helpers shared across abalone's HTTP
+// handlers.
+package httputils
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/danmane/abalone/go/errdefs"
+)
+
+// errorResponse is the JSON body WriteError sends to the client.
+type errorResponse struct {
+	Message string `json:"message"`
+	Kind    string `json:"kind"`
+}
+
+// WriteError inspects err's cause chain for one of the errdefs kinds and
+// writes the matching HTTP status code along with
+// {"message": ..., "kind": ...}. Errors that don't match any known kind
+// are reported as a 500 with kind "system".
+func WriteError(w http.ResponseWriter, err error) {
+	status, kind := http.StatusInternalServerError, "system"
+	switch {
+	case errdefs.IsNotFound(err):
+		status, kind = http.StatusNotFound, "not-found"
+	case errdefs.IsInvalidParameter(err):
+		status, kind = http.StatusBadRequest, "invalid-parameter"
+	case errdefs.IsConflict(err):
+		status, kind = http.StatusConflict, "conflict"
+	case errdefs.IsUnavailable(err):
+		status, kind = http.StatusServiceUnavailable, "unavailable"
+	case errdefs.IsSystem(err):
+		status, kind = http.StatusInternalServerError, "system"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorResponse{Message: err.Error(), Kind: kind})
+}
@@ -0,0 +1,63 @@
+// Package progress provides a small JSON-lines protocol for streaming
+// long-running operations (image pulls, builds, container validation) to
+// an HTTP client, modeled on the way Docker's engine API frames pull and
+// build progress.
+package progress
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Progress describes how far along a unit of work is, e.g. the bytes of a
+// layer downloaded so far.
+type Progress struct {
+	Current int64 `json:"current,omitempty"`
+	Total   int64 `json:"total,omitempty"`
+}
+
+// Event is a single line of the progress protocol. Phase identifies the
+// broad stage of work ("pull", "build", "create", "start",
+// "port-discover", "ping-retry N", "stop", ...); Status is a short
+// human-readable description of what's happening within that phase; ID
+// identifies the sub-unit of work the event applies to, such as a layer
+// or container ID, when there is more than one in flight.
+type Event struct {
+	Phase    string    `json:"phase"`
+	Status   string    `json:"status"`
+	ID       string    `json:"id,omitempty"`
+	Progress *Progress `json:"progress,omitempty"`
+}
+
+// Emitter writes Events to an http.ResponseWriter as newline-delimited
+// JSON, flushing after each one so the client can render progress as it
+// happens rather than buffering the whole response.
+type Emitter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+// NewEmitter wraps |w| for progress output. If |w| does not implement
+// http.Flusher, events are still written but may be buffered by
+// intermediate layers.
+func NewEmitter(w http.ResponseWriter) *Emitter {
+	flusher, _ := w.(http.Flusher)
+	return &Emitter{w: w, flusher: flusher}
+}
+
+// Emit writes a single event and flushes it to the client.
+func (e *Emitter) Emit(ev Event) error {
+	if err := json.NewEncoder(e.w).Encode(ev); err != nil {
+		return err
+	}
+	if e.flusher != nil {
+		e.flusher.Flush()
+	}
+	return nil
+}
+
+// Phase is a convenience for emitting a phase/status transition with no
+// progress payload, e.g. Emit(Event{Phase: "create", Status: "..."}).
+func (e *Emitter) Phase(phase, status string) error {
+	return e.Emit(Event{Phase: phase, Status: status})
+}
@@ -0,0 +1,88 @@
+package progress
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// flushRecorder wraps httptest.ResponseRecorder and overrides its Flush to
+// count how often NewEmitter's flushing code path flushes.
+type flushRecorder struct {
+	*httptest.ResponseRecorder
+	flushes int
+}
+
+func (f *flushRecorder) Flush() { f.flushes++ }
+
+func TestEmitWritesOneJSONObjectPerLine(t *testing.T) {
+	w := httptest.NewRecorder()
+	e := NewEmitter(w)
+
+	if err := e.Emit(Event{Phase: "pull", Status: "Downloading", ID: "layer1"}); err != nil {
+		t.Fatalf("Emit returned error: %s", err)
+	}
+	if err := e.Emit(Event{Phase: "pull", Status: "Download complete", ID: "layer1"}); err != nil {
+		t.Fatalf("Emit returned error: %s", err)
+	}
+
+	dec := json.NewDecoder(w.Body)
+	var got []Event
+	for {
+		var ev Event
+		if err := dec.Decode(&ev); err != nil {
+			break
+		}
+		got = append(got, ev)
+	}
+	if len(got) != 2 {
+		t.Fatalf("decoded %d events, want 2 (body: %q)", len(got), w.Body.String())
+	}
+	if got[0].Status != "Downloading" || got[1].Status != "Download complete" {
+		t.Fatalf("unexpected event contents: %+v", got)
+	}
+}
+
+func TestEmitFlushesAfterEveryEvent(t *testing.T) {
+	w := &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	e := NewEmitter(w)
+
+	e.Emit(Event{Phase: "pull", Status: "a"})
+	e.Emit(Event{Phase: "pull", Status: "b"})
+
+	if w.flushes != 2 {
+		t.Fatalf("flushes = %d, want 2", w.flushes)
+	}
+}
+
+func TestEmitWithoutFlusherStillWrites(t *testing.T) {
+	// httptest.ResponseRecorder implements http.Flusher, so wrap it in a
+	// type that only exposes http.ResponseWriter to exercise the
+	// non-Flusher path.
+	rec := httptest.NewRecorder()
+	var w http.ResponseWriter = struct {
+		http.ResponseWriter
+	}{rec}
+
+	e := NewEmitter(w)
+	if err := e.Emit(Event{Phase: "pull", Status: "a"}); err != nil {
+		t.Fatalf("Emit returned error: %s", err)
+	}
+	if !strings.Contains(rec.Body.String(), `"status":"a"`) {
+		t.Fatalf("expected event to be written, got %q", rec.Body.String())
+	}
+}
+
+func TestPhaseOmitsProgressWhenNotSet(t *testing.T) {
+	w := httptest.NewRecorder()
+	e := NewEmitter(w)
+
+	if err := e.Phase("create", "creating container"); err != nil {
+		t.Fatalf("Phase returned error: %s", err)
+	}
+	if strings.Contains(w.Body.String(), `"progress"`) {
+		t.Fatalf("expected no progress field in output, got %q", w.Body.String())
+	}
+}